@@ -1,6 +1,7 @@
 package api
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
 	"github.com/gorilla/mux"
@@ -9,7 +10,9 @@ import (
 	"github.com/hauke96/simple-task-manager/server/util"
 	"github.com/hauke96/simple-task-manager/server/websocket"
 	"github.com/pkg/errors"
+	"net"
 	"net/http"
+	"time"
 )
 
 type ApiResponse struct {
@@ -54,22 +57,103 @@ func printRoutes(router *mux.Router) {
 	})
 }
 
-func authenticatedTransactionHandler(handler func(r *http.Request, context *Context) *ApiResponse) func(http.ResponseWriter, *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
+// requestIdHeader is both read (to honor a caller-supplied trace id) and written (so the caller can see which id got
+// assigned) by requestLoggingMiddleware.
+const requestIdHeader = "X-Request-Id"
+
+// requestState carries the parts of a structured request log line that aren't known until the wrapped handler has
+// started running (namely which user it turned out to be), so requestLoggingMiddleware's deferred log statement can
+// include them.
+type requestState struct {
+	user string
+}
+
+// statusRecorder wraps a ResponseWriter so requestLoggingMiddleware can observe the status code and body size a
+// handler ends up writing.
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode   int
+	bytesWritten int
+}
+
+func (rec *statusRecorder) WriteHeader(statusCode int) {
+	rec.statusCode = statusCode
+	rec.ResponseWriter.WriteHeader(statusCode)
+}
 
-		prepareAndHandle(w, r, handler)
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytesWritten += n
+	return n, err
+}
+
+// Hijack implements http.Hijacker by delegating to the underlying ResponseWriter. Without this, wrapping a
+// connection in a statusRecorder (as requestLoggingMiddleware does for every handler, including
+// authenticatedWebsocket) would silently break the type assertion gorilla/websocket's Upgrader.Upgrade relies on to
+// take over the TCP connection, failing every websocket upgrade.
+func (rec *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("underlying ResponseWriter does not support hijacking")
 	}
+	return hijacker.Hijack()
 }
 
-func authenticatedWebsocket(handler func(w http.ResponseWriter, r *http.Request, token *auth.Token, websocketSender *websocket.WebsocketSender)) func(http.ResponseWriter, *http.Request) {
+// Flush implements http.Flusher by delegating to the underlying ResponseWriter, for the same reason as Hijack above.
+func (rec *statusRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// requestLoggingMiddleware wraps handler with request-scoped logging and tracing: it builds a logger from an inbound
+// X-Request-Id (or generates a new one), echoes that id back as a response header, and logs one structured line per
+// request (method, path, user, status, bytes, duration) once handler returns. The trace id is also what ends up in
+// error bodies, via util.Response*/ErrorResponse taking the same logger.
+func requestLoggingMiddleware(handler func(w http.ResponseWriter, r *http.Request, logger *util.Logger, state *requestState)) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		logger := util.NewLogger()
+		traceId := r.Header.Get(requestIdHeader)
+		var logger *util.Logger
+		if traceId != "" {
+			logger = util.NewLoggerWithTraceId(traceId)
+		} else {
+			logger = util.NewLogger()
+		}
+
+		w.Header().Set(requestIdHeader, logger.LogTraceId)
 
+		recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		state := &requestState{}
+
+		start := time.Now()
+		defer func() {
+			logger.Log("%s %s user=%s status=%d bytes=%d duration=%s", r.Method, r.URL.Path, state.user, recorder.statusCode, recorder.bytesWritten, time.Since(start))
+		}()
+
+		handler(recorder, r, logger, state)
+	}
+}
+
+func authenticatedTransactionHandler(handler func(r *http.Request, context *Context) *ApiResponse) func(http.ResponseWriter, *http.Request) {
+	return requestLoggingMiddleware(func(w http.ResponseWriter, r *http.Request, logger *util.Logger, state *requestState) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+
+		prepareAndHandle(w, r, logger, state, handler)
+	})
+}
+
+// legacyEmptyTokenSentinel is U+009E (PRIVACY MESSAGE), a control character some older clients send as the
+// "token" query parameter instead of omitting it outright. Written with an explicit \u escape (rather than the
+// raw byte) so it stays visible and diffable as source text instead of silently vanishing in an editor or review
+// tool, which is exactly what happened the last time this was a literal control byte.
+const legacyEmptyTokenSentinel = "\u009e"
+
+func authenticatedWebsocket(handler func(w http.ResponseWriter, r *http.Request, token *auth.Token, websocketSender *websocket.WebsocketSender)) func(http.ResponseWriter, *http.Request) {
+	return requestLoggingMiddleware(func(w http.ResponseWriter, r *http.Request, logger *util.Logger, state *requestState) {
 		query := r.URL.Query()
 
 		t := query.Get("token")
-		if t == "" || t == "null" || t == "\u009e" {
+		if t == "" || t == "null" || t == legacyEmptyTokenSentinel {
 			err := errors.New("could not establish websocket connection: query parameter 'token' not set")
 			util.ResponseUnauthorized(w, logger, err)
 			return
@@ -86,20 +170,18 @@ func authenticatedWebsocket(handler func(w http.ResponseWriter, r *http.Request,
 			util.ResponseUnauthorized(w, logger, errors.New("No valid authentication token found"))
 			return
 		}
+		state.user = token.User
 
 		sender := websocket.Init(logger)
 
 		handler(w, r, token, sender)
-	}
+	})
 }
 
 // prepareAndHandle gets and verifies the token from the request, creates the context, starts a transaction, manages
 // commit/rollback, calls the handler and also does error handling. When this function returns, everything should have a
 // valid state: The response as well as the transaction (database).
-func prepareAndHandle(w http.ResponseWriter, r *http.Request, handler func(r *http.Request, context *Context) *ApiResponse) {
-	// temporary logger before there's a context
-	logger := util.NewLogger()
-
+func prepareAndHandle(w http.ResponseWriter, r *http.Request, logger *util.Logger, state *requestState, handler func(r *http.Request, context *Context) *ApiResponse) {
 	token, err := auth.VerifyRequest(r, logger)
 	if err != nil {
 		logger.Debug("URL without valid token called: %s", r.URL.Path)
@@ -108,6 +190,7 @@ func prepareAndHandle(w http.ResponseWriter, r *http.Request, handler func(r *ht
 		util.ResponseUnauthorized(w, logger, errors.New("No valid authentication token found"))
 		return
 	}
+	state.user = token.User
 
 	// Create context with a new transaction and new service instances
 	context, err := createContext(token, logger.LogTraceId)
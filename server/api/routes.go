@@ -0,0 +1,33 @@
+package api
+
+import (
+	"github.com/gorilla/mux"
+
+	"github.com/hauke96/simple-task-manager/server/auth"
+)
+
+// Init mounts every route this package (and the handlers auth exposes directly, rather than through
+// authenticatedTransactionHandler/authenticatedWebsocket) serves onto router. It's the single place those routes are
+// registered - main is expected to build router, call auth.Init() so providers are registered, and then call this
+// before it starts listening.
+func Init(router *mux.Router) {
+	router.HandleFunc("/oauth/login", auth.OauthLogin).Methods("GET")
+	// Must match the callback URL OSMProvider hands to OSM (see auth.NewOSMProvider).
+	router.HandleFunc("/oauth_callback", auth.OauthCallback).Methods("GET")
+
+	// Serves the public half of the JWT signing keystore, so clients and other services can verify STM tokens
+	// without calling back into this server.
+	router.HandleFunc("/.well-known/jwks.json", auth.JWKSHandler).Methods("GET")
+
+	// Lets an operator holding config.Conf.AdminApiKey revoke every outstanding token for a user, e.g. after an OSM
+	// account compromise.
+	router.HandleFunc("/auth/admin/revoke-user", auth.AdminRevokeUser).Methods("POST")
+
+	// Exposes the OSM HTTP client's circuit breaker state for scraping, so operators can see OSM outages as they
+	// happen. Only mounted if an OSM provider actually got registered (see auth.Init).
+	if metricsHandler, ok := auth.OSMMetricsHandler(); ok {
+		router.HandleFunc("/metrics", metricsHandler).Methods("GET")
+	}
+
+	printRoutes(router)
+}
@@ -2,79 +2,72 @@ package auth
 
 import (
 	"crypto/rand"
-	"crypto/sha256"
-	"encoding/xml"
-	"github.com/pkg/errors"
-	"time"
-
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
+	"time"
 
 	"github.com/hauke96/sigolo"
-	"github.com/kurrik/oauth1a"
+	"github.com/pkg/errors"
 
 	"github.com/hauke96/simple-task-manager/server/config"
+	"github.com/hauke96/simple-task-manager/server/sessionstore"
 	"github.com/hauke96/simple-task-manager/server/util"
 )
 
-var (
-	oauthRedirectUrl  string
-	oauthConsumerKey  string
-	oauthSecret       string
-	oauthBaseUrl      string
-	osmUserDetailsUrl string
-
-	service *oauth1a.Service
+// loginSessionTtl is how long a started login may stay unfinished before its state is considered stale and rejected.
+// This bounds the window in which a leaked "state"/"provider" pair could be replayed.
+const loginSessionTtl = 10 * time.Minute
 
+var (
 	tokenValidityDuration time.Duration
 
-	configs map[string]*oauth1a.UserConfig
-	loggers map[string]*util.Logger
+	// sessions holds in-flight login attempts across all providers, keyed by the "state" value the provider handed
+	// back from StartLogin. Using a TTL'd store instead of a plain map means abandoned logins are evicted instead of
+	// pinned in memory forever. With the Redis-backed store, entries also survive a restart and any STM instance
+	// behind a load balancer can complete a login started on another; the in-memory default offers neither.
+	sessions sessionstore.SessionStore
 )
 
+// loginSession is the provider-agnostic state auth.OauthCallback needs to finish a login: which provider to ask and
+// where to send the user once it has a token. Its fields are exported and it carries a trace id rather than a live
+// *util.Logger, because OauthLogin marshals it to JSON before handing it to sessions.Put, and a backend-agnostic store may round-trip it through
+// Redis on a different STM instance entirely.
+type loginSession struct {
+	ProviderName      string `json:"providerName"`
+	ClientRedirectUrl string `json:"clientRedirectUrl"`
+	TraceId           string `json:"traceId"`
+}
+
 func Init() {
 	err := tokenInit()
 	sigolo.FatalCheck(err)
 
-	oauthRedirectUrl = fmt.Sprintf("%s:%d/oauth_callback", config.Conf.ServerUrl, config.Conf.Port)
-	oauthConsumerKey = config.Conf.OauthConsumerKey
-	oauthSecret = config.Conf.OauthSecret
-	oauthBaseUrl = config.Conf.OsmBaseUrl
-	osmUserDetailsUrl = config.Conf.OsmBaseUrl + "/api/0.6/user/details"
-
-	service = &oauth1a.Service{
-		RequestURL:   config.Conf.OsmBaseUrl + "/oauth/request_token",
-		AuthorizeURL: config.Conf.OsmBaseUrl + "/oauth/authorize",
-		AccessURL:    config.Conf.OsmBaseUrl + "/oauth/access_token",
-		ClientConfig: &oauth1a.ClientConfig{
-			ConsumerKey:    oauthConsumerKey,
-			ConsumerSecret: oauthSecret,
-			CallbackURL:    oauthRedirectUrl,
-		},
-		Signer: new(oauth1a.HmacSha1Signer),
-	}
-
 	tokenValidityDuration, err = time.ParseDuration(config.Conf.TokenValidityDuration)
 	sigolo.FatalCheckf(err, "unable to parse token validity duration from config entry '%s'", config.Conf.TokenValidityDuration)
 
-	configs = make(map[string]*oauth1a.UserConfig)
-	loggers = make(map[string]*util.Logger)
+	sessions = sessionstore.New(config.Conf.SessionStoreBackend, "login", config.Conf.RedisAddr, config.Conf.RedisPassword, config.Conf.RedisDb)
+
+	providers = make(map[string]Provider)
+	RegisterProvider(NewOSMProvider())
+	if config.Conf.TestProviderEnabled {
+		RegisterProvider(NewTestProvider())
+	}
 }
 
+// OauthLogin starts a login against the provider named by the "provider" request parameter (falling back to "osm"
+// for clients that don't send one yet).
 func OauthLogin(w http.ResponseWriter, r *http.Request) {
 	logger := util.NewLogger()
-	userConfig := &oauth1a.UserConfig{}
 
-	randomBytes, err := getRandomBytes(64)
+	provider, err := providerForRequest(r)
 	if err != nil {
 		logger.Stack(err)
-		util.ResponseInternalError(w, logger, errors.New("Could not get random bytes for config key"))
+		util.ResponseBadRequest(w, logger, err)
 		return
 	}
 
-	configKey := fmt.Sprintf("%x", sha256.Sum256(randomBytes))
-
 	clientRedirectUrl, err := util.GetParam("redirect", r)
 	if err != nil {
 		logger.Stack(err)
@@ -82,94 +75,91 @@ func OauthLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// We add the config-param to the redirect URL in order to transfer the config key to the callback function. There
-	// we use this key to retrieve the config back and be able to make proper requests to the OSM server..
-	// The redirect param is the URL of the web application we want to redirect back to, after everything is done.
-	service.ClientConfig.CallbackURL = oauthRedirectUrl + "?redirect=" + clientRedirectUrl + "&config=" + configKey
-	logger.Log("%s", service.ClientConfig.CallbackURL)
-
-	httpClient := new(http.Client)
-	err = userConfig.GetRequestToken(service, httpClient)
+	redirectURL, state, err := provider.StartLogin(w, r)
 	if err != nil {
-		//sigolo.Error("could not get request token from config: %s", err.Error())
 		logger.Stack(err)
+		util.ResponseInternalError(w, logger, errors.Wrap(err, "Could not start login"))
 		return
 	}
 
-	url, err := userConfig.GetAuthorizeURL(service)
+	if state == "" {
+		// The provider completed the login synchronously within this request (e.g. the dev/test provider).
+		finishLogin(w, r, logger, provider, clientRedirectUrl)
+		return
+	}
+
+	entry, err := json.Marshal(&loginSession{
+		ProviderName:      provider.Name(),
+		ClientRedirectUrl: clientRedirectUrl,
+		TraceId:           logger.LogTraceId,
+	})
 	if err != nil {
-		//sigolo.Error("could not get authorization URL from config: %s", err.Error())
 		logger.Stack(err)
+		util.ResponseInternalError(w, logger, errors.Wrap(err, "Could not encode login session"))
 		return
 	}
 
-	logger.Debug("Redirect to URL: %s", url)
+	err = sessions.Put(state, entry, loginSessionTtl)
+	if err != nil {
+		logger.Stack(err)
+		util.ResponseInternalError(w, logger, errors.Wrap(err, "Could not store login session"))
+		return
+	}
 
-	configs[configKey] = userConfig
-	loggers[configKey] = logger
+	logger.Debug("Redirect to URL: %s", redirectURL)
 
-	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
+	http.Redirect(w, r, redirectURL, http.StatusTemporaryRedirect)
 }
 
+// OauthCallback finishes a login started by OauthLogin, dispatching back to the same provider.
 func OauthCallback(w http.ResponseWriter, r *http.Request) {
 	sigolo.Debug("Callback called")
 
-	configKey, err := util.GetParam("config", r)
+	state, err := util.GetParam("state", r)
 	if err != nil {
 		logger := util.NewLogger()
-		logger.Err("Could not load config key from request URL")
 		logger.Stack(err)
 		util.ResponseBadRequest(w, logger, err)
 		return
 	}
 
-	// Get the logger for this login process.
-	logger, ok := loggers[configKey]
-	if !ok || logger == nil {
-		err := errors.New(fmt.Sprintf("Logger for config key %s not found", configKey))
+	// Take the session so a second callback with the same (replayed or expired) state finds nothing.
+	raw, ok := sessions.Take(state)
+	var session loginSession
+	if ok {
+		ok = json.Unmarshal(raw, &session) == nil
+	}
+	if !ok {
 		logger := util.NewLogger()
+		err := errors.New("Unknown, expired or already used login state")
 		logger.Stack(err)
 		util.ResponseBadRequest(w, logger, err)
 		return
 	}
-	loggers[configKey] = nil // Remove the config, we don't need it  anymore
 
-	// Get the config where the request tokens are stored in. They are needed later to get some basic user information.
-	userConfig, ok := configs[configKey]
-	if !ok || userConfig == nil {
-		err := errors.New("User config not found")
-		logger.Stack(err)
-		util.ResponseBadRequest(w, logger, err)
-		return
-	}
-	configs[configKey] = nil // Remove the config, we don't need it  anymore
+	logger := util.NewLoggerWithTraceId(session.TraceId)
 
-	// This gets the redirect URL of the web-client. So e.g. "https://stm-hauke-stieler.de/oauth-landing"
-	clientRedirectUrl, err := util.GetParam("redirect", r)
-	if err != nil {
+	provider, ok := getProvider(session.ProviderName)
+	if !ok {
+		err := errors.Errorf("Unknown auth provider '%s'", session.ProviderName)
 		logger.Stack(err)
 		util.ResponseBadRequest(w, logger, err)
 		return
 	}
 
-	// Request access token from the OSM server in order to then get some user information.
-	err = requestAccessToken(r, userConfig)
-	if err != nil {
-		logger.Stack(err)
-		util.ResponseInternalError(w, logger, err)
-		return
-	}
+	finishLogin(w, r, logger, provider, session.ClientRedirectUrl)
+}
 
-	userName, userId, err := requestUserInformation(userConfig)
+// finishLogin calls provider.CompleteLogin, issues a session token for the returned user and redirects the browser
+// back to clientRedirectUrl with that token attached.
+func finishLogin(w http.ResponseWriter, r *http.Request, logger *util.Logger, provider Provider, clientRedirectUrl string) {
+	userId, userName, err := provider.CompleteLogin(r)
 	if err != nil {
 		logger.Stack(err)
 		util.ResponseInternalError(w, logger, err)
 		return
 	}
 
-	// Until here, the user is considered to be successfully logged in. Now we can create the token used to authenticate
-	// against this server.
-
 	logger.Log("Create token for user '%s'", userName)
 
 	validUntil := time.Now().Add(tokenValidityDuration).Unix()
@@ -186,43 +176,20 @@ func OauthCallback(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, clientRedirectUrl+"?token="+encodedTokenString, http.StatusTemporaryRedirect)
 }
 
-func requestAccessToken(r *http.Request, userConfig *oauth1a.UserConfig) error {
-	token := r.FormValue("oauth_token")
-	userConfig.AccessTokenSecret = token
-	userConfig.Verifier = r.FormValue("oauth_verifier")
-
-	httpClient := new(http.Client)
-	return userConfig.GetAccessToken(userConfig.RequestTokenKey, userConfig.Verifier, service, httpClient)
-}
-
-func requestUserInformation(userConfig *oauth1a.UserConfig) (string, string, error) {
-	req, err := http.NewRequest("GET", osmUserDetailsUrl, nil)
-	if err != nil {
-		return "", "", errors.Wrap(err, "Creating request user information failed")
+// providerForRequest looks up the Provider named by the "provider" request parameter, falling back to "osm" when
+// none is given so existing clients that don't know about other providers keep working unchanged.
+func providerForRequest(r *http.Request) (Provider, error) {
+	name := r.FormValue("provider")
+	if name == "" {
+		name = "osm"
 	}
 
-	// The OSM server expects a signed request
-	err = service.Sign(req, userConfig)
-	if err != nil {
-		return "", "", errors.Wrap(err, "Signing request failed")
+	provider, ok := getProvider(name)
+	if !ok {
+		return nil, errors.Errorf("Unknown auth provider '%s'", name)
 	}
 
-	client := &http.Client{}
-	response, err := client.Do(req)
-	if err != nil {
-		return "", "", errors.Wrap(err, "Requesting user information failed")
-	}
-
-	responseBody, err := ioutil.ReadAll(response.Body)
-	defer response.Body.Close()
-	if err != nil {
-		return "", "", errors.Wrap(err, "Could not get response body")
-	}
-
-	var osm util.Osm
-	xml.Unmarshal(responseBody, &osm)
-
-	return osm.User.DisplayName, osm.User.UserId, nil
+	return provider, nil
 }
 
 func getRandomBytes(count int) ([]byte, error) {
@@ -240,6 +207,14 @@ func getRandomBytes(count int) ([]byte, error) {
 	return bytes, nil
 }
 
+func randomUrlSafeString(byteCount int) (string, error) {
+	randomBytes, err := getRandomBytes(byteCount)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(randomBytes), nil
+}
+
 // verifyRequest checks the integrity of the token and the "validUntil" date. It
 // then returns the token but without the secret part, just the meta information
 // (e.g. user name) is set.
@@ -0,0 +1,203 @@
+// Package keystore manages the RSA keys used to sign and verify the STM session tokens (see auth.createTokenString
+// and auth.verifyToken). It supports overlapping keys so a key can be rotated without invalidating tokens that were
+// signed with the previous one, and serves the public half as a JWKS document for clients and websocket peers that
+// want to verify tokens independently of this server.
+package keystore
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const keyBits = 2048
+
+// currentFile names the file (inside the keystore directory) that holds the kid of the current signing key.
+const currentFile = "current"
+
+// Keystore holds every RSA key that's still valid for verification, plus which one is currently used for signing.
+// New tokens are always signed with the current key; older keys are kept around (and still exposed via JWKS) for the
+// whole lifetime of the Keystore. Nothing removes a key, neither from memory nor from the keystore directory.
+type Keystore struct {
+	mutex      sync.RWMutex
+	keys       map[string]*rsa.PrivateKey // kid -> key
+	currentKid string
+}
+
+// Load reads every "<kid>.pem" file in dir into a Keystore. If dir is empty or contains no keys, a fresh key is
+// generated and written to dir so restarts reuse it (and therefore don't invalidate every outstanding token).
+func Load(dir string) (*Keystore, error) {
+	ks := &Keystore{keys: make(map[string]*rsa.PrivateKey)}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "read keystore directory")
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".pem" {
+			continue
+		}
+
+		kid := strings.TrimSuffix(entry.Name(), ".pem")
+
+		keyBytes, err := ioutil.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, errors.Wrapf(err, "read key file for kid '%s'", kid)
+		}
+
+		key, err := parsePrivateKey(keyBytes)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse key file for kid '%s'", kid)
+		}
+
+		ks.keys[kid] = key
+	}
+
+	if len(ks.keys) == 0 {
+		return ks, ks.Rotate(dir)
+	}
+
+	currentKid, err := ioutil.ReadFile(filepath.Join(dir, currentFile))
+	if err != nil {
+		return nil, errors.Wrap(err, "read current signing key marker")
+	}
+	ks.currentKid = strings.TrimSpace(string(currentKid))
+
+	if _, ok := ks.keys[ks.currentKid]; !ok {
+		return nil, errors.Errorf("current signing key '%s' has no matching key file", ks.currentKid)
+	}
+
+	return ks, nil
+}
+
+// Rotate generates a new signing key, adds it to the keystore under a fresh kid and makes it the current signing
+// key. Older keys are kept for verification so tokens signed with them remain valid until they expire. If dir is
+// non-empty the new key is also persisted there.
+func (ks *Keystore) Rotate(dir string) error {
+	key, err := rsa.GenerateKey(rand.Reader, keyBits)
+	if err != nil {
+		return errors.Wrap(err, "generate RSA key")
+	}
+
+	kid, err := randomKid()
+	if err != nil {
+		return err
+	}
+
+	ks.mutex.Lock()
+	ks.keys[kid] = key
+	ks.currentKid = kid
+	ks.mutex.Unlock()
+
+	if dir != "" {
+		if err := persistKey(dir, kid, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Current returns the kid and private key that should be used to sign a new token.
+func (ks *Keystore) Current() (kid string, key *rsa.PrivateKey) {
+	ks.mutex.RLock()
+	defer ks.mutex.RUnlock()
+
+	return ks.currentKid, ks.keys[ks.currentKid]
+}
+
+// PublicKey returns the public key for kid, or false if no key with that kid is known. Verification
+// of older tokens goes through this so a rotation doesn't invalidate tokens signed shortly before it.
+func (ks *Keystore) PublicKey(kid string) (*rsa.PublicKey, bool) {
+	ks.mutex.RLock()
+	defer ks.mutex.RUnlock()
+
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, false
+	}
+
+	return &key.PublicKey, true
+}
+
+// jwk is a single entry of a JSON Web Key Set, RFC 7517.
+type jwk struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+// JWKS renders every known public key as a JSON Web Key Set document, suitable for serving at
+// "/.well-known/jwks.json".
+func (ks *Keystore) JWKS() ([]byte, error) {
+	ks.mutex.RLock()
+	defer ks.mutex.RUnlock()
+
+	set := jwks{Keys: make([]jwk, 0, len(ks.keys))}
+	for kid, key := range ks.keys {
+		set.Keys = append(set.Keys, jwk{
+			Kty: "RSA",
+			Use: "sig",
+			Alg: "RS256",
+			Kid: kid,
+			N:   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+		})
+	}
+
+	return json.Marshal(set)
+}
+
+// persistKey writes kid's PEM file to dir and repoints the "current" marker at it.
+func persistKey(dir, kid string, key *rsa.PrivateKey) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errors.Wrap(err, "create keystore directory")
+	}
+
+	block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, kid+".pem"), pem.EncodeToMemory(block), 0600); err != nil {
+		return errors.Wrap(err, "write key file")
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, currentFile), []byte(kid), 0600)
+}
+
+// randomKid generates a short, URL- and filename-safe identifier for a newly rotated key.
+func randomKid() (string, error) {
+	raw := make([]byte, 8)
+	if _, err := rand.Read(raw); err != nil {
+		return "", errors.Wrap(err, "generate kid")
+	}
+
+	return hex.EncodeToString(raw), nil
+}
+
+func parsePrivateKey(pemBytes []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
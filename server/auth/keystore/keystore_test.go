@@ -0,0 +1,83 @@
+package keystore
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestLoadGeneratesAKeyWhenDirIsEmpty(t *testing.T) {
+	ks, err := Load("")
+	if err != nil {
+		t.Fatalf("load: %s", err)
+	}
+
+	kid, key := ks.Current()
+	if kid == "" || key == nil {
+		t.Fatalf("expected a generated current key, got kid=%q key=%v", kid, key)
+	}
+}
+
+func TestRotateKeepsThePreviousKeyVerifiable(t *testing.T) {
+	ks, err := Load("")
+	if err != nil {
+		t.Fatalf("load: %s", err)
+	}
+	oldKid, _ := ks.Current()
+
+	if err := ks.Rotate(""); err != nil {
+		t.Fatalf("rotate: %s", err)
+	}
+	newKid, _ := ks.Current()
+
+	if newKid == oldKid {
+		t.Fatal("expected rotate to pick a new kid")
+	}
+	if _, ok := ks.PublicKey(oldKid); !ok {
+		t.Fatal("expected the pre-rotation key to remain available for verification")
+	}
+}
+
+func TestPublicKeyReportsUnknownKid(t *testing.T) {
+	ks, err := Load("")
+	if err != nil {
+		t.Fatalf("load: %s", err)
+	}
+
+	if _, ok := ks.PublicKey("does-not-exist"); ok {
+		t.Fatal("expected an unknown kid to report false")
+	}
+}
+
+func TestJWKSRendersEveryKnownKey(t *testing.T) {
+	ks, err := Load("")
+	if err != nil {
+		t.Fatalf("load: %s", err)
+	}
+	if err := ks.Rotate(""); err != nil {
+		t.Fatalf("rotate: %s", err)
+	}
+
+	body, err := ks.JWKS()
+	if err != nil {
+		t.Fatalf("jwks: %s", err)
+	}
+
+	var doc struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("unmarshal jwks: %s", err)
+	}
+
+	if len(doc.Keys) != 2 {
+		t.Fatalf("expected 2 keys in the JWKS after one rotation, got %d", len(doc.Keys))
+	}
+	for _, key := range doc.Keys {
+		if key.Kty != "RSA" {
+			t.Fatalf("expected every key to report kty=RSA, got %q", key.Kty)
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/kurrik/oauth1a"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+
+	"github.com/hauke96/simple-task-manager/server/auth/osmclient"
+	"github.com/hauke96/simple-task-manager/server/config"
+	"github.com/hauke96/simple-task-manager/server/sessionstore"
+	"github.com/hauke96/simple-task-manager/server/util"
+)
+
+// osmSessionTtl bounds how long a login against OSM may stay unfinished before its server-side state (the OAuth1
+// request token or the OAuth2 PKCE verifier) is discarded.
+const osmSessionTtl = 10 * time.Minute
+
+// OSMProvider is the Provider that authenticates against a real OSM server, either via the legacy OAuth 1.0a dance
+// (while config.Conf.OauthUseLegacyV1 is set, so already-deployed clients keep working during the migration) or via
+// OAuth 2.0 with PKCE.
+type OSMProvider struct {
+	oauthRedirectUrl  string
+	osmUserDetailsUrl string
+
+	service      *oauth1a.Service
+	oauth2Config *oauth2.Config
+
+	// httpClient is used for every call to OSM: it applies a timeout, retries with backoff on 5xx/network errors,
+	// and trips a circuit breaker instead of piling up stalled requests while OSM is down.
+	httpClient *osmclient.Client
+
+	// sessions holds the server-side secret each in-flight OSM login needs between StartLogin and CompleteLogin: the
+	// OAuth1 request token, or the OAuth2 PKCE verifier. It's kept separate from auth's generic login-session store
+	// because that secret must never be reachable from the "state" value that's handed to the browser/OSM; it's also
+	// given its own "osm-login" namespace (see sessionstore.New) so the two stores never collide on the same "state"
+	// key when both happen to share a Redis server/DB.
+	sessions sessionstore.SessionStore
+}
+
+// oauth1Session is the per-login state kept for the legacy OAuth1 flow. Its field is exported because it is marshaled
+// to JSON before being handed to p.sessions.Put.
+type oauth1Session struct {
+	UserConfig *oauth1a.UserConfig `json:"userConfig"`
+}
+
+// pkceSession is the per-login state kept for the OAuth2+PKCE flow. Its field is exported because it is marshaled to
+// JSON before being handed to p.sessions.Put.
+type pkceSession struct {
+	Verifier string `json:"verifier"`
+}
+
+// NewOSMProvider builds the OSMProvider from config.Conf. Init calls this once and registers the result.
+func NewOSMProvider() *OSMProvider {
+	oauthRedirectUrl := fmt.Sprintf("%s:%d/oauth_callback", config.Conf.ServerUrl, config.Conf.Port)
+
+	service := &oauth1a.Service{
+		RequestURL:   config.Conf.OsmBaseUrl + "/oauth/request_token",
+		AuthorizeURL: config.Conf.OsmBaseUrl + "/oauth/authorize",
+		AccessURL:    config.Conf.OsmBaseUrl + "/oauth/access_token",
+		ClientConfig: &oauth1a.ClientConfig{
+			ConsumerKey:    config.Conf.OauthConsumerKey,
+			ConsumerSecret: config.Conf.OauthSecret,
+			CallbackURL:    oauthRedirectUrl,
+		},
+		Signer: new(oauth1a.HmacSha1Signer),
+	}
+
+	scopes := config.Conf.OauthScopes
+	if len(scopes) == 0 {
+		scopes = []string{"read_prefs", "write_api"}
+	}
+
+	oauth2Config := &oauth2.Config{
+		ClientID:     config.Conf.OauthClientId,
+		ClientSecret: config.Conf.OauthClientSecret,
+		RedirectURL:  oauthRedirectUrl,
+		Scopes:       scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  config.Conf.OsmBaseUrl + "/oauth2/authorize",
+			TokenURL: config.Conf.OsmBaseUrl + "/oauth2/token",
+		},
+	}
+
+	return &OSMProvider{
+		oauthRedirectUrl:  oauthRedirectUrl,
+		osmUserDetailsUrl: config.Conf.OsmBaseUrl + "/api/0.6/user/details",
+		service:           service,
+		oauth2Config:      oauth2Config,
+		httpClient: osmclient.New(osmclient.Config{
+			Timeout:                 config.Conf.OsmClientTimeout,
+			MaxRetries:              config.Conf.OsmClientMaxRetries,
+			BreakerFailureThreshold: config.Conf.OsmClientBreakerFailureThreshold,
+			BreakerResetTimeout:     config.Conf.OsmClientBreakerResetTimeout,
+		}),
+		sessions: sessionstore.New(config.Conf.SessionStoreBackend, "osm-login", config.Conf.RedisAddr, config.Conf.RedisPassword, config.Conf.RedisDb),
+	}
+}
+
+func (p *OSMProvider) Name() string {
+	return "osm"
+}
+
+// Metrics exposes the OSM HTTP client's circuit breaker state, so it can be mounted at a "/metrics" route.
+func (p *OSMProvider) Metrics() http.HandlerFunc {
+	return osmclient.MetricsHandler(p.httpClient)
+}
+
+// OSMMetricsHandler returns the registered "osm" provider's Metrics handler, so callers outside this package (e.g.
+// route registration) can mount it without reaching into auth's internal provider registry or needing their own
+// reference to the *OSMProvider Init built. ok is false if no OSM provider is currently registered.
+func OSMMetricsHandler() (handler http.HandlerFunc, ok bool) {
+	provider, ok := getProvider("osm")
+	if !ok {
+		return nil, false
+	}
+
+	osmProvider, ok := provider.(*OSMProvider)
+	if !ok {
+		return nil, false
+	}
+
+	return osmProvider.Metrics(), true
+}
+
+func (p *OSMProvider) StartLogin(w http.ResponseWriter, r *http.Request) (string, string, error) {
+	if config.Conf.OauthUseLegacyV1 {
+		return p.startLoginV1(r)
+	}
+	return p.startLoginV2(r)
+}
+
+func (p *OSMProvider) CompleteLogin(r *http.Request) (string, string, error) {
+	if config.Conf.OauthUseLegacyV1 {
+		return p.completeLoginV1(r)
+	}
+	return p.completeLoginV2(r)
+}
+
+func (p *OSMProvider) startLoginV2(r *http.Request) (string, string, error) {
+	state, err := randomUrlSafeString(32)
+	if err != nil {
+		return "", "", errors.Wrap(err, "create state for OAuth2 login")
+	}
+
+	verifier, err := randomUrlSafeString(64)
+	if err != nil {
+		return "", "", errors.Wrap(err, "create PKCE verifier for OAuth2 login")
+	}
+
+	entry, err := json.Marshal(&pkceSession{Verifier: verifier})
+	if err != nil {
+		return "", "", errors.Wrap(err, "encode OAuth2 login session")
+	}
+
+	err = p.sessions.Put(state, entry, osmSessionTtl)
+	if err != nil {
+		return "", "", errors.Wrap(err, "store OAuth2 login session")
+	}
+
+	challenge := pkceChallenge(verifier)
+
+	authUrl := p.oauth2Config.AuthCodeURL(
+		state,
+		oauth2.SetAuthURLParam("code_challenge", challenge),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	)
+
+	return authUrl, state, nil
+}
+
+func (p *OSMProvider) completeLoginV2(r *http.Request) (string, string, error) {
+	state, err := util.GetParam("state", r)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Take the session so a second callback with the same (replayed or expired) state finds nothing.
+	raw, ok := p.sessions.Take(state)
+	var session pkceSession
+	if ok {
+		ok = json.Unmarshal(raw, &session) == nil
+	}
+	if !ok {
+		return "", "", errors.New("Unknown, expired or already used OAuth2 state")
+	}
+
+	code, err := util.GetParam("code", r)
+	if err != nil {
+		return "", "", err
+	}
+
+	ctx := osmclient.WithClient(r.Context(), p.httpClient)
+
+	token, err := p.oauth2Config.Exchange(
+		ctx,
+		code,
+		oauth2.SetAuthURLParam("code_verifier", session.Verifier),
+	)
+	if err != nil {
+		return "", "", errors.Wrap(err, "Requesting access token failed")
+	}
+
+	return p.requestUserInformationV2(ctx, token)
+}
+
+func (p *OSMProvider) requestUserInformationV2(ctx context.Context, token *oauth2.Token) (string, string, error) {
+	client := p.oauth2Config.Client(ctx, token)
+	// oauth2 only takes the Transport from the context's client, so carry its Timeout over as well.
+	client.Timeout = p.httpClient.Timeout
+
+	response, err := client.Get(p.osmUserDetailsUrl)
+	if err != nil {
+		return "", "", errors.Wrap(err, "Requesting user information failed")
+	}
+	defer response.Body.Close()
+
+	responseBody, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return "", "", errors.Wrap(err, "Could not get response body")
+	}
+
+	var osm util.Osm
+	xml.Unmarshal(responseBody, &osm)
+
+	return osm.User.UserId, osm.User.DisplayName, nil
+}
+
+// pkceChallenge derives the S256 code challenge from a PKCE code verifier as specified in RFC 7636.
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (p *OSMProvider) startLoginV1(r *http.Request) (string, string, error) {
+	userConfig := &oauth1a.UserConfig{}
+
+	state, err := randomUrlSafeString(32)
+	if err != nil {
+		return "", "", errors.Wrap(err, "create state for OAuth1 login")
+	}
+
+	// We add the state to the callback URL in order to transfer it to the callback function. There we use it to
+	// retrieve the request token back and be able to make proper requests to the OSM server.
+	p.service.ClientConfig.CallbackURL = p.oauthRedirectUrl + "?state=" + state
+
+	err = userConfig.GetRequestToken(p.service, p.httpClient.Client)
+	if err != nil {
+		return "", "", errors.Wrap(err, "could not get request token from config")
+	}
+
+	authorizeUrl, err := userConfig.GetAuthorizeURL(p.service)
+	if err != nil {
+		return "", "", errors.Wrap(err, "could not get authorization URL from config")
+	}
+
+	entry, err := json.Marshal(&oauth1Session{UserConfig: userConfig})
+	if err != nil {
+		return "", "", errors.Wrap(err, "encode OAuth1 login session")
+	}
+
+	err = p.sessions.Put(state, entry, osmSessionTtl)
+	if err != nil {
+		return "", "", errors.Wrap(err, "store OAuth1 login session")
+	}
+
+	return authorizeUrl, state, nil
+}
+
+func (p *OSMProvider) completeLoginV1(r *http.Request) (string, string, error) {
+	state, err := util.GetParam("state", r)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Take the session so a second callback with the same (replayed or expired) state finds nothing.
+	raw, ok := p.sessions.Take(state)
+	var session oauth1Session
+	if ok {
+		ok = json.Unmarshal(raw, &session) == nil
+	}
+	if !ok || session.UserConfig == nil {
+		return "", "", errors.New("Unknown, expired or already used OAuth1 state")
+	}
+
+	err = p.requestAccessToken(r, session.UserConfig)
+	if err != nil {
+		return "", "", err
+	}
+
+	return p.requestUserInformation(r.Context(), session.UserConfig)
+}
+
+func (p *OSMProvider) requestAccessToken(r *http.Request, userConfig *oauth1a.UserConfig) error {
+	userConfig.AccessTokenSecret = r.FormValue("oauth_token")
+	userConfig.Verifier = r.FormValue("oauth_verifier")
+
+	return userConfig.GetAccessToken(userConfig.RequestTokenKey, userConfig.Verifier, p.service, p.httpClient.Client)
+}
+
+func (p *OSMProvider) requestUserInformation(ctx context.Context, userConfig *oauth1a.UserConfig) (string, string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", p.osmUserDetailsUrl, nil)
+	if err != nil {
+		return "", "", errors.Wrap(err, "Creating request user information failed")
+	}
+
+	// The OSM server expects a signed request
+	err = p.service.Sign(req, userConfig)
+	if err != nil {
+		return "", "", errors.Wrap(err, "Signing request failed")
+	}
+
+	response, err := p.httpClient.Do(req)
+	if err != nil {
+		return "", "", errors.Wrap(err, "Requesting user information failed")
+	}
+	defer response.Body.Close()
+
+	responseBody, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return "", "", errors.Wrap(err, "Could not get response body")
+	}
+
+	var osm util.Osm
+	xml.Unmarshal(responseBody, &osm)
+
+	return osm.User.UserId, osm.User.DisplayName, nil
+}
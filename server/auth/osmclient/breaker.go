@@ -0,0 +1,112 @@
+package osmclient
+
+import (
+	"sync"
+	"time"
+)
+
+// breakerState is the classic three-state circuit breaker state machine.
+type breakerState int
+
+const (
+	stateClosed breakerState = iota
+	stateOpen
+	stateHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case stateOpen:
+		return "open"
+	case stateHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// breaker is a simple failure-rate circuit breaker: once failureThreshold consecutive requests have failed, it trips
+// to "open" and short-circuits every call for resetTimeout. After that, a single "half-open" probe is let through; it
+// closes the breaker again on success or re-opens it on failure.
+type breaker struct {
+	mutex sync.Mutex
+
+	failureThreshold int
+	resetTimeout     time.Duration
+
+	state           breakerState
+	consecutiveFail int
+	openedAt        time.Time
+}
+
+func newBreaker(failureThreshold int, resetTimeout time.Duration) *breaker {
+	if failureThreshold <= 0 {
+		failureThreshold = 5
+	}
+	if resetTimeout <= 0 {
+		resetTimeout = 30 * time.Second
+	}
+
+	return &breaker{
+		failureThreshold: failureThreshold,
+		resetTimeout:     resetTimeout,
+		state:            stateClosed,
+	}
+}
+
+// allow reports whether a call should be let through right now, transitioning open->half-open once resetTimeout has
+// elapsed. While half-open, only the call that made that transition gets through; every other call is blocked until
+// it records its outcome.
+func (b *breaker) allow() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.state == stateHalfOpen {
+		return false
+	}
+
+	if b.state == stateOpen {
+		if time.Since(b.openedAt) < b.resetTimeout {
+			return false
+		}
+		b.state = stateHalfOpen
+	}
+
+	return true
+}
+
+func (b *breaker) recordSuccess() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.consecutiveFail = 0
+	b.state = stateClosed
+}
+
+func (b *breaker) recordFailure() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.state == stateHalfOpen {
+		b.trip()
+		return
+	}
+
+	b.consecutiveFail++
+	if b.consecutiveFail >= b.failureThreshold {
+		b.trip()
+	}
+}
+
+func (b *breaker) trip() {
+	b.state = stateOpen
+	b.openedAt = time.Now()
+}
+
+// State returns the breaker's current state as a label suitable for a metrics endpoint.
+func (b *breaker) State() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.state.String()
+}
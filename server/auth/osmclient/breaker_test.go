@@ -0,0 +1,75 @@
+package osmclient
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreakerTripsAfterConsecutiveFailures(t *testing.T) {
+	b := newBreaker(3, time.Hour)
+
+	for i := 0; i < 2; i++ {
+		if !b.allow() {
+			t.Fatalf("expected breaker to allow call %d before the failure threshold is reached", i)
+		}
+		b.recordFailure()
+	}
+	if b.State() != "closed" {
+		t.Fatalf("expected breaker to still be closed after 2 of 3 failures, got %q", b.State())
+	}
+
+	b.recordFailure()
+	if b.State() != "open" {
+		t.Fatalf("expected breaker to trip open after 3 consecutive failures, got %q", b.State())
+	}
+	if b.allow() {
+		t.Fatal("expected an open breaker to block calls")
+	}
+}
+
+func TestBreakerSuccessResetsFailureCount(t *testing.T) {
+	b := newBreaker(2, time.Hour)
+
+	b.recordFailure()
+	b.recordSuccess()
+	b.recordFailure()
+	if b.State() != "closed" {
+		t.Fatalf("expected a success in between to reset the failure count, got %q", b.State())
+	}
+}
+
+func TestBreakerHalfOpenClosesOnSuccessfulProbe(t *testing.T) {
+	b := newBreaker(1, time.Millisecond)
+
+	b.recordFailure()
+	if b.State() != "open" {
+		t.Fatalf("expected breaker to be open after a single failure, got %q", b.State())
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	if !b.allow() {
+		t.Fatal("expected breaker to let a probe through once resetTimeout has elapsed")
+	}
+	if b.State() != "half-open" {
+		t.Fatalf("expected breaker to be half-open after letting a probe through, got %q", b.State())
+	}
+
+	b.recordSuccess()
+	if b.State() != "closed" {
+		t.Fatalf("expected a successful probe to close the breaker, got %q", b.State())
+	}
+}
+
+func TestBreakerHalfOpenReopensOnFailedProbe(t *testing.T) {
+	b := newBreaker(1, time.Millisecond)
+
+	b.recordFailure()
+	time.Sleep(5 * time.Millisecond)
+	b.allow()
+
+	b.recordFailure()
+	if b.State() != "open" {
+		t.Fatalf("expected a failed probe to reopen the breaker, got %q", b.State())
+	}
+}
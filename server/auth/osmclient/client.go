@@ -0,0 +1,173 @@
+// Package osmclient provides the *http.Client the auth package uses for every call to the OSM API: a per-call
+// timeout, exponential-backoff retries for 5xx responses and network errors (honoring a "Retry-After" header), and a
+// circuit breaker that short-circuits calls while OSM looks down instead of piling up stalled goroutines.
+package osmclient
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+)
+
+// Config controls the client's timeout, retry and circuit breaker behaviour. Zero values fall back to sane defaults
+// (see New), so config.Conf only needs to set the fields an operator actually wants to tune.
+type Config struct {
+	// Timeout bounds a whole call, including connection setup, every retry and the backoff waits between them. Zero
+	// uses DefaultTimeout.
+	Timeout time.Duration
+
+	// MaxRetries is how many additional attempts are made after the first one fails with a 5xx or network error.
+	// Zero uses DefaultMaxRetries.
+	MaxRetries int
+
+	// BaseBackoff is the starting delay for exponential backoff between retries (doubled on every further attempt,
+	// unless OSM sends a "Retry-After" header, which takes precedence). Zero uses DefaultBaseBackoff.
+	BaseBackoff time.Duration
+
+	// BreakerFailureThreshold is how many consecutive failures trip the circuit breaker. Zero uses
+	// DefaultBreakerFailureThreshold.
+	BreakerFailureThreshold int
+
+	// BreakerResetTimeout is how long the breaker stays open before letting a single probe request through. Zero
+	// uses DefaultBreakerResetTimeout.
+	BreakerResetTimeout time.Duration
+}
+
+const (
+	DefaultTimeout                 = 10 * time.Second
+	DefaultMaxRetries              = 2
+	DefaultBaseBackoff             = 200 * time.Millisecond
+	DefaultBreakerFailureThreshold = 5
+	DefaultBreakerResetTimeout     = 30 * time.Second
+)
+
+// Client wraps an *http.Client configured with the timeout/retry/breaker Transport below. It's embedded so callers
+// that need a plain *http.Client (e.g. oauth1a.UserConfig.GetRequestToken, or golang.org/x/oauth2 via context) can
+// use Client.Client directly.
+type Client struct {
+	*http.Client
+	breaker *breaker
+}
+
+// New builds a Client from cfg, applying defaults for every zero field.
+func New(cfg Config) *Client {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = DefaultMaxRetries
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = DefaultBaseBackoff
+	}
+
+	b := newBreaker(cfg.BreakerFailureThreshold, cfg.BreakerResetTimeout)
+
+	return &Client{
+		Client: &http.Client{
+			Timeout: cfg.Timeout,
+			Transport: &retryTransport{
+				next:        http.DefaultTransport,
+				breaker:     b,
+				maxRetries:  cfg.MaxRetries,
+				baseBackoff: cfg.BaseBackoff,
+			},
+		},
+		breaker: b,
+	}
+}
+
+// BreakerState reports the circuit breaker's current state ("closed", "open" or "half-open"), for exposing on a
+// /metrics endpoint so operators can see OSM outages.
+func (c *Client) BreakerState() string {
+	return c.breaker.State()
+}
+
+// WithClient returns a context carrying c as the *http.Client golang.org/x/oauth2 should use for token exchanges and
+// authenticated requests, so those calls get the same timeout/retry/breaker behaviour as everything else here.
+func WithClient(ctx context.Context, c *Client) context.Context {
+	return context.WithValue(ctx, oauth2.HTTPClient, c.Client)
+}
+
+// retryTransport is an http.RoundTripper that retries 5xx responses and network errors with exponential backoff
+// (honoring "Retry-After"), behind a circuit breaker that short-circuits once OSM has failed repeatedly in a row. A
+// short-circuited call returns an error and no response; it does not produce a synthetic 503 response.
+type retryTransport struct {
+	next        http.RoundTripper
+	breaker     *breaker
+	maxRetries  int
+	baseBackoff time.Duration
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.breaker.allow() {
+		return nil, errors.New("osmclient: circuit breaker open, OSM appears to be down")
+	}
+
+	var lastErr error
+
+	for attempt := 0; attempt <= t.maxRetries; attempt++ {
+		resp, err := t.next.RoundTrip(req)
+
+		if err == nil && resp.StatusCode < 500 {
+			t.breaker.recordSuccess()
+			return resp, nil
+		}
+
+		t.breaker.recordFailure()
+
+		if err != nil {
+			lastErr = err
+		} else {
+			lastErr = errors.Errorf("osm responded with status %d", resp.StatusCode)
+		}
+
+		if attempt == t.maxRetries {
+			break
+		}
+
+		wait := backoffDuration(attempt, t.baseBackoff)
+		if err == nil {
+			resp.Body.Close()
+			if retryAfter, ok := retryAfterDelay(resp); ok {
+				wait = retryAfter
+			}
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+	}
+
+	return nil, lastErr
+}
+
+func backoffDuration(attempt int, base time.Duration) time.Duration {
+	return base << uint(attempt)
+}
+
+// retryAfterDelay parses the "Retry-After" header as either a number of seconds or an HTTP date, as RFC 7231 allows.
+func retryAfterDelay(resp *http.Response) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if when, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(when); delay > 0 {
+			return delay, true
+		}
+	}
+
+	return 0, false
+}
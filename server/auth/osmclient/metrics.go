@@ -0,0 +1,29 @@
+package osmclient
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// MetricsHandler renders c's circuit breaker state in the Prometheus text exposition format, so it can be mounted at
+// a "/metrics" route for operators to see OSM outages as they happen.
+func MetricsHandler(c *Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+		fmt.Fprintln(w, "# HELP stm_osm_circuit_breaker_state Current state of the OSM API circuit breaker (0=closed, 1=half-open, 2=open).")
+		fmt.Fprintln(w, "# TYPE stm_osm_circuit_breaker_state gauge")
+		fmt.Fprintf(w, "stm_osm_circuit_breaker_state{state=\"%s\"} %d\n", c.BreakerState(), breakerStateValue(c.BreakerState()))
+	}
+}
+
+func breakerStateValue(state string) int {
+	switch state {
+	case "half-open":
+		return 1
+	case "open":
+		return 2
+	default:
+		return 0
+	}
+}
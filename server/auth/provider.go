@@ -0,0 +1,33 @@
+package auth
+
+import "net/http"
+
+// Provider abstracts a single login method. auth.OauthLogin/auth.OauthCallback drive any registered Provider the
+// same way, so adding a new identity source (an internal OSM mirror a team hosts, a staging fixture, ...) never
+// requires touching handler code, just a new Provider implementation and a RegisterProvider call in Init.
+type Provider interface {
+	// Name identifies the provider, e.g. in the "provider" query parameter and in stored login sessions.
+	Name() string
+
+	// StartLogin begins a login: it may write directly to w (e.g. rendering a form) and/or return a URL the caller
+	// should be redirected to. state identifies this login attempt for the later CompleteLogin call; an empty state
+	// means the provider already completed the login within this single request (no redirect round trip needed), in
+	// which case CompleteLogin is called immediately with the same request.
+	StartLogin(w http.ResponseWriter, r *http.Request) (redirectURL string, state string, err error)
+
+	// CompleteLogin finishes a login started by StartLogin and returns the now-authenticated OSM user.
+	CompleteLogin(r *http.Request) (userID string, userName string, err error)
+}
+
+// providers holds every registered Provider, keyed by Name(). Populated once during Init.
+var providers map[string]Provider
+
+// RegisterProvider makes p available under p.Name() for OauthLogin/OauthCallback to look up.
+func RegisterProvider(p Provider) {
+	providers[p.Name()] = p
+}
+
+func getProvider(name string) (Provider, bool) {
+	p, ok := providers[name]
+	return p, ok
+}
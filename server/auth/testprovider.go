@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/hauke96/simple-task-manager/server/config"
+	"github.com/hauke96/simple-task-manager/server/util"
+)
+
+// TestProvider is a Provider for local development and integration tests: it accepts a form-posted username/uid and
+// immediately "logs in" as that user, without ever talking to OSM. It's gated by config.Conf.TestProviderEnabled and
+// refuses to start at all if the server isn't bound to loopback, so it can never accidentally end up reachable in a
+// real deployment.
+type TestProvider struct{}
+
+func NewTestProvider() *TestProvider {
+	return &TestProvider{}
+}
+
+func (p *TestProvider) Name() string {
+	return "test"
+}
+
+// StartLogin only validates that the test provider is allowed to run here; the actual "login" happens in
+// CompleteLogin using the same request, so it returns an empty state to signal that no redirect round trip is
+// needed.
+func (p *TestProvider) StartLogin(w http.ResponseWriter, r *http.Request) (string, string, error) {
+	if !config.Conf.TestProviderEnabled {
+		return "", "", errors.New("test auth provider is disabled")
+	}
+
+	// config.Conf.ServerUrl is the externally-advertised base URL (used to build the OAuth callback); it says nothing
+	// about which interface this process actually has bound. config.Conf.BindAddress is the "host:port" (or ":port")
+	// passed to http.ListenAndServe, which is what actually determines who can reach this provider.
+	if !isLoopback(config.Conf.BindAddress) {
+		return "", "", errors.New("test auth provider refuses to run on a non-loopback bind address")
+	}
+
+	return "", "", nil
+}
+
+func (p *TestProvider) CompleteLogin(r *http.Request) (string, string, error) {
+	uid, err := util.GetParam("uid", r)
+	if err != nil {
+		return "", "", err
+	}
+
+	userName, err := util.GetParam("username", r)
+	if err != nil {
+		return "", "", err
+	}
+
+	return uid, userName, nil
+}
+
+// isLoopback reports whether addr - a net.Listen-style address such as "127.0.0.1:8080", "localhost:8080" or
+// ":8080" - only accepts connections on a loopback interface. An address with no host (":8080") binds every
+// interface, so that's deliberately not loopback.
+func isLoopback(addr string) bool {
+	host := addr
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		host = h
+	}
+
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
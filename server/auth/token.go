@@ -0,0 +1,198 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+
+	"github.com/hauke96/simple-task-manager/server/auth/keystore"
+	"github.com/hauke96/simple-task-manager/server/config"
+	"github.com/hauke96/simple-task-manager/server/sessionstore"
+	"github.com/hauke96/simple-task-manager/server/util"
+)
+
+// Token is the verified, user-facing view of a session token: just enough to identify who's calling. Secret is kept
+// for API compatibility with code that clears it after verification; it's always empty since the JWT format has no
+// secret part to strip.
+type Token struct {
+	UID    string
+	User   string
+	Secret string
+}
+
+// tokenClaims is the JWT claim set STM issues. It embeds jwt.StandardClaims for "iat"/"exp"/"jti" and adds the two
+// claims STM actually needs to identify the caller.
+type tokenClaims struct {
+	jwt.StandardClaims
+	UID  string `json:"sub"`
+	Name string `json:"name"`
+}
+
+var (
+	keys *keystore.Keystore
+
+	// revocations tracks revoked tokens (by jti) and revoked users (by "user:<uid>" -> revoked-at unix timestamp,
+	// used to reject every token issued before an account was flagged, e.g. after an OSM account compromise).
+	revocations sessionstore.SessionStore
+)
+
+func tokenInit() error {
+	var err error
+
+	keys, err = keystore.Load(config.Conf.JwtKeyDir)
+	if err != nil {
+		return errors.Wrap(err, "load JWT keystore")
+	}
+
+	revocations = sessionstore.New(config.Conf.SessionStoreBackend, "revocation", config.Conf.RedisAddr, config.Conf.RedisPassword, config.Conf.RedisDb)
+
+	return nil
+}
+
+// createTokenString signs a JWT for the given user, valid until validUntil (unix seconds).
+func createTokenString(logger *util.Logger, userName string, uid string, validUntil int64) (string, error) {
+	kid, privateKey := keys.Current()
+	if privateKey == nil {
+		return "", errors.New("no signing key available")
+	}
+
+	jti, err := randomUrlSafeString(16)
+	if err != nil {
+		return "", errors.Wrap(err, "create token id")
+	}
+
+	claims := tokenClaims{
+		StandardClaims: jwt.StandardClaims{
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: validUntil,
+			Id:        jti,
+		},
+		UID:  uid,
+		Name: userName,
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+
+	signed, err := token.SignedString(privateKey)
+	if err != nil {
+		return "", errors.Wrap(err, "sign token")
+	}
+
+	logger.Debug("Signed token for user '%s' with kid '%s'", userName, kid)
+
+	return signed, nil
+}
+
+// verifyToken parses and validates encodedToken: signature (via the kid header and the keystore), expiry (handled by
+// the jwt library from the "exp" claim) and revocation (by jti, and by a bulk per-user revocation marker).
+func verifyToken(logger *util.Logger, encodedToken string) (*Token, error) {
+	claims := &tokenClaims{}
+
+	_, err := jwt.ParseWithClaims(encodedToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, ok := token.Header["kid"].(string)
+		if !ok {
+			return nil, errors.New("token has no 'kid' header")
+		}
+
+		publicKey, ok := keys.PublicKey(kid)
+		if !ok {
+			return nil, errors.Errorf("unknown signing key '%s'", kid)
+		}
+
+		return publicKey, nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "parse token")
+	}
+
+	if _, revoked := revocations.Peek(revocationKey(claims.Id)); revoked {
+		return nil, errors.New("token has been revoked")
+	}
+
+	if raw, ok := revocations.Peek(userRevocationKey(claims.UID)); ok {
+		revokedAt, err := strconv.ParseInt(string(raw), 10, 64)
+		if err == nil && claims.IssuedAt <= revokedAt {
+			return nil, errors.New("all tokens for this user have been revoked")
+		}
+	}
+
+	logger.Debug("Token for user '%s' has valid signature and is not revoked", claims.Name)
+
+	return &Token{UID: claims.UID, User: claims.Name}, nil
+}
+
+// RevokeToken revokes a single token by its jti, e.g. when a specific token is known to have leaked.
+func RevokeToken(jti string) error {
+	return revocations.Put(revocationKey(jti), []byte("1"), maxTokenLifetime())
+}
+
+// RevokeUser revokes every token issued for uid up to now, e.g. after an OSM account compromise. Issue times are
+// compared in whole seconds, so a token issued in the same second as the call is revoked too; tokens issued in a
+// later second remain valid.
+func RevokeUser(uid string) error {
+	revokedAt := strconv.FormatInt(time.Now().Unix(), 10)
+	return revocations.Put(userRevocationKey(uid), []byte(revokedAt), maxTokenLifetime())
+}
+
+// AdminRevokeUser is an HTTP handler that revokes every outstanding token for the "uid" form/query parameter. It's
+// gated by a shared secret (config.Conf.AdminApiKey) rather than a user token, since the whole point is to be usable
+// even when that user's own token might be compromised.
+func AdminRevokeUser(w http.ResponseWriter, r *http.Request) {
+	logger := util.NewLogger()
+
+	if config.Conf.AdminApiKey == "" || r.Header.Get("X-Admin-Api-Key") != config.Conf.AdminApiKey {
+		util.ResponseUnauthorized(w, logger, errors.New("Missing or invalid admin API key"))
+		return
+	}
+
+	uid, err := util.GetParam("uid", r)
+	if err != nil {
+		util.ResponseBadRequest(w, logger, err)
+		return
+	}
+
+	if err := RevokeUser(uid); err != nil {
+		logger.Stack(err)
+		util.ResponseInternalError(w, logger, errors.Wrap(err, "Could not revoke tokens for user"))
+		return
+	}
+
+	logger.Log("Revoked all tokens for user '%s'", uid)
+	w.WriteHeader(http.StatusOK)
+}
+
+// JWKSHandler serves the public half of the keystore as a JSON Web Key Set at "/.well-known/jwks.json", so clients
+// and websocket peers can verify STM tokens without calling back into this server.
+func JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	logger := util.NewLogger()
+
+	body, err := keys.JWKS()
+	if err != nil {
+		logger.Stack(err)
+		util.ResponseInternalError(w, logger, errors.Wrap(err, "Could not render JWKS"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+func revocationKey(jti string) string {
+	return fmt.Sprintf("jti:%s", jti)
+}
+
+func userRevocationKey(uid string) string {
+	return fmt.Sprintf("user:%s", uid)
+}
+
+func maxTokenLifetime() time.Duration {
+	if tokenValidityDuration > 0 {
+		return tokenValidityDuration
+	}
+	return 24 * time.Hour
+}
@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"github.com/hauke96/simple-task-manager/server/auth/keystore"
+	"github.com/hauke96/simple-task-manager/server/sessionstore"
+	"github.com/hauke96/simple-task-manager/server/util"
+)
+
+// setUpTokenTest wires up the package-level keys/revocations/tokenValidityDuration a real Init() would set up from
+// config, without needing a config package: a freshly generated (not persisted) keystore and an in-memory
+// revocation store.
+func setUpTokenTest(t *testing.T) {
+	t.Helper()
+
+	var err error
+	keys, err = keystore.Load("")
+	if err != nil {
+		t.Fatalf("load keystore: %s", err)
+	}
+
+	revocations = sessionstore.NewMemoryStore(time.Minute)
+	tokenValidityDuration = time.Hour
+}
+
+func TestCreateAndVerifyTokenRoundTrip(t *testing.T) {
+	setUpTokenTest(t)
+
+	logger := util.NewLogger()
+	validUntil := time.Now().Add(tokenValidityDuration).Unix()
+
+	signed, err := createTokenString(logger, "alice", "uid-1", validUntil)
+	if err != nil {
+		t.Fatalf("create token: %s", err)
+	}
+
+	token, err := verifyToken(logger, signed)
+	if err != nil {
+		t.Fatalf("verify token: %s", err)
+	}
+
+	if token.UID != "uid-1" || token.User != "alice" {
+		t.Fatalf("unexpected token contents: %+v", token)
+	}
+}
+
+func TestVerifyTokenRejectsTamperedSignature(t *testing.T) {
+	setUpTokenTest(t)
+
+	logger := util.NewLogger()
+	validUntil := time.Now().Add(tokenValidityDuration).Unix()
+
+	signed, err := createTokenString(logger, "alice", "uid-1", validUntil)
+	if err != nil {
+		t.Fatalf("create token: %s", err)
+	}
+
+	tampered := signed[:len(signed)-1] + "x"
+
+	if _, err := verifyToken(logger, tampered); err == nil {
+		t.Fatal("expected a tampered token to fail verification")
+	}
+}
+
+func TestRevokeUserRejectsTokensIssuedBeforeRevocation(t *testing.T) {
+	setUpTokenTest(t)
+
+	logger := util.NewLogger()
+	validUntil := time.Now().Add(tokenValidityDuration).Unix()
+
+	signed, err := createTokenString(logger, "alice", "uid-1", validUntil)
+	if err != nil {
+		t.Fatalf("create token: %s", err)
+	}
+
+	if err := RevokeUser("uid-1"); err != nil {
+		t.Fatalf("revoke user: %s", err)
+	}
+
+	if _, err := verifyToken(logger, signed); err == nil {
+		t.Fatal("expected a token issued before a user-wide revocation to fail verification")
+	}
+}
+
+func TestRevokeTokenRejectsThatTokenOnly(t *testing.T) {
+	setUpTokenTest(t)
+
+	logger := util.NewLogger()
+	validUntil := time.Now().Add(tokenValidityDuration).Unix()
+
+	revokedToken, err := createTokenString(logger, "alice", "uid-1", validUntil)
+	if err != nil {
+		t.Fatalf("create token: %s", err)
+	}
+	claims := &tokenClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(revokedToken, claims); err != nil {
+		t.Fatalf("parse claims: %s", err)
+	}
+
+	if err := RevokeToken(claims.Id); err != nil {
+		t.Fatalf("revoke token: %s", err)
+	}
+
+	if _, err := verifyToken(logger, revokedToken); err == nil {
+		t.Fatal("expected the revoked token to fail verification")
+	}
+
+	otherToken, err := createTokenString(logger, "alice", "uid-1", validUntil)
+	if err != nil {
+		t.Fatalf("create second token: %s", err)
+	}
+	if _, err := verifyToken(logger, otherToken); err != nil {
+		t.Fatalf("expected a different token for the same user to remain valid: %s", err)
+	}
+}
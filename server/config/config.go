@@ -0,0 +1,109 @@
+// Package config loads and holds the server's runtime configuration. Every other package reads its settings from
+// the single Conf value instead of taking its own flags/env vars, so there's one place an operator looks to see
+// what's configurable.
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Configuration holds every runtime setting the server reads via config.Conf. Fields are loaded from a JSON file by
+// LoadConfig; anything left at its Go zero value falls back to the default noted on that field (applied by
+// applyDefaults), so a config file only needs to set what it actually wants to override.
+type Configuration struct {
+	// ServerUrl is the externally-advertised base URL used to build the OAuth callback URL. It says nothing about
+	// which interface this process actually binds to - see BindAddress for that.
+	ServerUrl string `json:"serverUrl"`
+
+	// Port is the port ServerUrl is reachable on, combined with it to build the OAuth callback URL.
+	Port int `json:"port"`
+
+	// BindAddress is the "host:port" (or ":port") passed to http.ListenAndServe. Defaults to ":8080".
+	BindAddress string `json:"bindAddress"`
+
+	// OauthConsumerKey/OauthSecret are the OAuth1 consumer key/secret, used while OauthUseLegacyV1 is set.
+	OauthConsumerKey string `json:"oauthConsumerKey"`
+	OauthSecret      string `json:"oauthSecret"`
+
+	// OauthClientId/OauthClientSecret are the OAuth2 client credentials.
+	OauthClientId     string `json:"oauthClientId"`
+	OauthClientSecret string `json:"oauthClientSecret"`
+
+	// OauthScopes are the OAuth2 scopes requested at login. Empty falls back to {"read_prefs", "write_api"}.
+	OauthScopes []string `json:"oauthScopes"`
+
+	// OauthUseLegacyV1 switches OSM login to the legacy OAuth1 flow instead of OAuth2+PKCE, for clients that haven't
+	// migrated to OAuth2 yet.
+	OauthUseLegacyV1 bool `json:"oauthUseLegacyV1"`
+
+	// OsmBaseUrl is the OSM server's base URL, used to derive every OSM API/OAuth endpoint STM calls.
+	OsmBaseUrl string `json:"osmBaseUrl"`
+
+	// TokenValidityDuration is a time.ParseDuration string (e.g. "24h") for how long an issued session token stays
+	// valid. Defaults to "24h".
+	TokenValidityDuration string `json:"tokenValidityDuration"`
+
+	// JwtKeyDir is where the JWT signing keystore persists its RSA keys. Empty keeps keys in memory only, so a
+	// restart rotates to a fresh key and invalidates every outstanding token.
+	JwtKeyDir string `json:"jwtKeyDir"`
+
+	// AdminApiKey gates auth.AdminRevokeUser (via the "X-Admin-Api-Key" header). Empty disables the endpoint.
+	AdminApiKey string `json:"adminApiKey"`
+
+	// SessionStoreBackend selects the sessionstore.New backend: "redis", or anything else (including empty) for the
+	// in-memory default.
+	SessionStoreBackend string `json:"sessionStoreBackend"`
+	RedisAddr           string `json:"redisAddr"`
+	RedisPassword       string `json:"redisPassword"`
+	RedisDb             int    `json:"redisDb"`
+
+	// TestProviderEnabled registers the dev/test auth.Provider. It also requires BindAddress to be loopback-only
+	// (see auth.TestProvider.StartLogin), so it can't end up reachable in a real deployment by accident.
+	TestProviderEnabled bool `json:"testProviderEnabled"`
+
+	// OsmClientTimeout/OsmClientMaxRetries/OsmClientBreakerFailureThreshold/OsmClientBreakerResetTimeout configure
+	// the osmclient.Client used for every call to OSM. Zero values fall back to osmclient's own defaults (see
+	// osmclient.Config), so they're left unset here rather than duplicating those defaults.
+	OsmClientTimeout                 time.Duration `json:"osmClientTimeout"`
+	OsmClientMaxRetries              int           `json:"osmClientMaxRetries"`
+	OsmClientBreakerFailureThreshold int           `json:"osmClientBreakerFailureThreshold"`
+	OsmClientBreakerResetTimeout     time.Duration `json:"osmClientBreakerResetTimeout"`
+}
+
+// Conf is the configuration loaded by LoadConfig. Every package that needs a setting reads it from here.
+var Conf *Configuration
+
+// LoadConfig reads the JSON configuration file at path into Conf, filling in defaults for anything left unset.
+func LoadConfig(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "open config file")
+	}
+	defer file.Close()
+
+	conf := &Configuration{}
+	if err := json.NewDecoder(file).Decode(conf); err != nil {
+		return errors.Wrap(err, "decode config file")
+	}
+
+	applyDefaults(conf)
+	Conf = conf
+
+	return nil
+}
+
+// applyDefaults fills in the handful of fields that would otherwise break their package outright if left at their Go
+// zero value (e.g. an empty TokenValidityDuration fails time.ParseDuration). Fields that already have a sensible
+// fallback where they're used (the osmclient.Config fields, SessionStoreBackend) are deliberately left alone here.
+func applyDefaults(conf *Configuration) {
+	if conf.BindAddress == "" {
+		conf.BindAddress = ":8080"
+	}
+	if conf.TokenValidityDuration == "" {
+		conf.TokenValidityDuration = "24h"
+	}
+}
@@ -0,0 +1,31 @@
+// Command simple-task-manager-server starts the STM HTTP server: it loads configuration, initializes auth (which
+// registers the OSM and, if enabled, dev/test login providers), builds the router, and starts listening.
+package main
+
+import (
+	"flag"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/hauke96/sigolo"
+
+	"github.com/hauke96/simple-task-manager/server/api"
+	"github.com/hauke96/simple-task-manager/server/auth"
+	"github.com/hauke96/simple-task-manager/server/config"
+)
+
+func main() {
+	configFile := flag.String("config", "config.json", "path to the JSON configuration file")
+	flag.Parse()
+
+	err := config.LoadConfig(*configFile)
+	sigolo.FatalCheckf(err, "unable to load config file '%s'", *configFile)
+
+	auth.Init()
+
+	router := mux.NewRouter()
+	api.Init(router)
+
+	sigolo.Info("Listening on %s", config.Conf.BindAddress)
+	sigolo.FatalCheck(http.ListenAndServe(config.Conf.BindAddress, router))
+}
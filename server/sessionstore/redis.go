@@ -0,0 +1,68 @@
+package sessionstore
+
+import (
+	gocontext "context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+)
+
+// redisStore is a SessionStore backed by Redis, so in-flight sessions survive an STM restart and are visible to
+// every instance behind a load balancer. Entries are stored exactly as given, so it's up to the caller to hand Put an
+// already-marshaled (e.g. JSON) value and to unmarshal what Take/Peek return. Every key is prefixed with namespace so
+// that independent stores sharing the same Redis server/DB (see New) never collide.
+type redisStore struct {
+	client    *redis.Client
+	namespace string
+}
+
+// NewRedisStore creates a SessionStore backed by the Redis instance reachable at addr (host:port), namespacing every
+// key it handles with namespace.
+func NewRedisStore(namespace, addr, password string, db int) SessionStore {
+	return &redisStore{
+		namespace: namespace,
+		client: redis.NewClient(&redis.Options{
+			Addr:     addr,
+			Password: password,
+			DB:       db,
+		}),
+	}
+}
+
+func (s *redisStore) prefixed(key string) string {
+	return s.namespace + ":" + key
+}
+
+func (s *redisStore) Put(key string, value []byte, ttl time.Duration) error {
+	err := s.client.Set(gocontext.Background(), s.prefixed(key), value, ttl).Err()
+	if err != nil {
+		return errors.Wrap(err, "put entry into redis session store")
+	}
+
+	return nil
+}
+
+func (s *redisStore) Take(key string) ([]byte, bool) {
+	// GetDel atomically reads and removes the key, giving us the same "take" semantics as the in-memory store
+	// (and therefore the same replay protection).
+	value, err := s.client.GetDel(gocontext.Background(), s.prefixed(key)).Bytes()
+	if err != nil {
+		return nil, false
+	}
+
+	return value, true
+}
+
+func (s *redisStore) Peek(key string) ([]byte, bool) {
+	value, err := s.client.Get(gocontext.Background(), s.prefixed(key)).Bytes()
+	if err != nil {
+		return nil, false
+	}
+
+	return value, true
+}
+
+func (s *redisStore) Close() error {
+	return s.client.Close()
+}
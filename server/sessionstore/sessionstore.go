@@ -0,0 +1,150 @@
+// Package sessionstore provides a pluggable, TTL'd key-value store for short-lived server-side state such as
+// in-flight OAuth logins. Unlike the old "map[string]*... as a global" approach, entries expire on their own and the
+// store can be swapped for a shared backend (e.g. Redis) so multiple STM instances behind a load balancer see the
+// same sessions.
+package sessionstore
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SessionStore is a TTL'd key-value store for short-lived, per-session entries. Entries are opaque byte slices: a
+// caller puts a struct in by marshaling it (e.g. with encoding/json) and unmarshals it back out after Take/Peek, so
+// every backend (including one that has to cross a process boundary, like Redis) round-trips entries the same way.
+// Implementations must be safe for concurrent use.
+type SessionStore interface {
+	// Put stores value under key. The entry is no longer retrievable after ttl has elapsed.
+	Put(key string, value []byte, ttl time.Duration) error
+
+	// Take atomically retrieves and removes the entry stored under key. ok is false when there is no (non-expired)
+	// entry for key, which also covers the case of a replayed key that was already taken once.
+	Take(key string) (value []byte, ok bool)
+
+	// Peek retrieves the entry stored under key without removing it, e.g. for membership checks like a revocation
+	// list where the same key is expected to be looked up many times before it expires.
+	Peek(key string) (value []byte, ok bool)
+
+	// Close releases resources held by the store (e.g. stops the janitor goroutine or closes a connection pool).
+	Close() error
+}
+
+type memoryItem struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// memoryStore is the in-memory SessionStore implementation. It's the default: fine for a single STM instance, but
+// entries don't survive a restart and aren't visible to other instances.
+type memoryStore struct {
+	mutex sync.Mutex
+	items map[string]*memoryItem
+	stop  chan struct{}
+}
+
+// NewMemoryStore creates an in-memory SessionStore. A janitor goroutine sweeps expired entries every
+// janitorInterval so abandoned sessions don't pile up; it's stopped by Close.
+func NewMemoryStore(janitorInterval time.Duration) SessionStore {
+	store := &memoryStore{
+		items: make(map[string]*memoryItem),
+		stop:  make(chan struct{}),
+	}
+
+	go store.runJanitor(janitorInterval)
+
+	return store
+}
+
+func (s *memoryStore) Put(key string, value []byte, ttl time.Duration) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.items[key] = &memoryItem{
+		value:     value,
+		expiresAt: time.Now().Add(ttl),
+	}
+
+	return nil
+}
+
+func (s *memoryStore) Take(key string) ([]byte, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	item, ok := s.items[key]
+	delete(s.items, key)
+
+	if !ok || time.Now().After(item.expiresAt) {
+		return nil, false
+	}
+
+	return item.value, true
+}
+
+func (s *memoryStore) Peek(key string) ([]byte, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	item, ok := s.items[key]
+	if !ok || time.Now().After(item.expiresAt) {
+		return nil, false
+	}
+
+	return item.value, true
+}
+
+func (s *memoryStore) Close() error {
+	close(s.stop)
+	return nil
+}
+
+func (s *memoryStore) runJanitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.sweep()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *memoryStore) sweep() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	for key, item := range s.items {
+		if now.After(item.expiresAt) {
+			delete(s.items, key)
+		}
+	}
+}
+
+// ErrNotFound is not currently returned by any implementation (Take reports absence via its "ok" flag instead) but is
+// kept here for callers that want a sentinel to check against future implementations.
+var ErrNotFound = errors.New("session store: entry not found")
+
+// defaultJanitorInterval is how often the in-memory store sweeps expired entries.
+const defaultJanitorInterval = time.Minute
+
+// New creates the SessionStore selected by backend ("memory" or "redis"). An empty or unknown backend falls back to
+// "memory" so existing single-instance deployments keep working without a config change.
+//
+// namespace is prefixed onto every key before it reaches the backend. It matters for "redis": every caller of New
+// with the same redisAddr/redisDb shares one keyspace, so two independent stores (e.g. auth's generic login-session
+// store and OSMProvider's provider-secret store) keying on the same value - the OAuth "state" - would otherwise read
+// and delete each other's entries. A distinct namespace per call site keeps them apart. It's a no-op for "memory",
+// since each New call there already gets its own, separate map.
+func New(backend, namespace, redisAddr, redisPassword string, redisDb int) SessionStore {
+	if backend == "redis" {
+		return NewRedisStore(namespace, redisAddr, redisPassword, redisDb)
+	}
+
+	return NewMemoryStore(defaultJanitorInterval)
+}
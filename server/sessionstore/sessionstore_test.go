@@ -0,0 +1,67 @@
+package sessionstore
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStorePutTakeRoundTrip(t *testing.T) {
+	store := NewMemoryStore(time.Hour)
+	defer store.Close()
+
+	if err := store.Put("k", []byte("v"), time.Minute); err != nil {
+		t.Fatalf("put: %s", err)
+	}
+
+	value, ok := store.Take("k")
+	if !ok || string(value) != "v" {
+		t.Fatalf("expected to take back 'v', got %q (ok=%v)", value, ok)
+	}
+}
+
+func TestMemoryStoreTakeRemovesEntry(t *testing.T) {
+	store := NewMemoryStore(time.Hour)
+	defer store.Close()
+
+	store.Put("k", []byte("v"), time.Minute)
+	store.Take("k")
+
+	if _, ok := store.Take("k"); ok {
+		t.Fatal("expected a second take of the same key to find nothing, replay protection broken")
+	}
+}
+
+func TestMemoryStorePeekDoesNotConsume(t *testing.T) {
+	store := NewMemoryStore(time.Hour)
+	defer store.Close()
+
+	store.Put("k", []byte("v"), time.Minute)
+
+	if _, ok := store.Peek("k"); !ok {
+		t.Fatal("expected peek to find the entry")
+	}
+	if value, ok := store.Peek("k"); !ok || string(value) != "v" {
+		t.Fatalf("expected a second peek to still find the entry, got %q (ok=%v)", value, ok)
+	}
+}
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	store := NewMemoryStore(time.Hour)
+	defer store.Close()
+
+	store.Put("k", []byte("v"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := store.Take("k"); ok {
+		t.Fatal("expected an expired entry to be gone")
+	}
+}
+
+func TestNewFallsBackToMemoryForUnknownBackend(t *testing.T) {
+	store := New("something-unexpected", "test", "", "", 0)
+	defer store.Close()
+
+	if _, ok := store.(*memoryStore); !ok {
+		t.Fatalf("expected an unknown backend to fall back to memoryStore, got %T", store)
+	}
+}
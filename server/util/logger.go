@@ -0,0 +1,56 @@
+package util
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/hauke96/sigolo"
+)
+
+// Logger is a thin wrapper around sigolo that prefixes every line with a trace id, so a client reporting a bug (or an
+// operator grepping logs) can correlate every log line and error response belonging to one request.
+type Logger struct {
+	// LogTraceId identifies this logger (and therefore the request it belongs to) across every log line it writes
+	// and every error response built with it. See api.requestLoggingMiddleware for where it's generated/honored and
+	// returned to the caller in the "X-Request-Id" header.
+	LogTraceId string
+}
+
+// NewLogger creates a Logger with a freshly generated trace id. Prefer api.requestLoggingMiddleware's logger (which
+// honors an inbound "X-Request-Id") for anything handling an HTTP request; NewLogger is for code that runs outside
+// that middleware (e.g. before a trace id is known yet).
+func NewLogger() *Logger {
+	return &Logger{LogTraceId: generateTraceId()}
+}
+
+// NewLoggerWithTraceId creates a Logger that uses the given trace id instead of generating a new one, so a request's
+// logger can be based on a client-supplied "X-Request-Id".
+func NewLoggerWithTraceId(traceId string) *Logger {
+	return &Logger{LogTraceId: traceId}
+}
+
+func (l *Logger) Log(format string, args ...interface{}) {
+	sigolo.Info("[%s] "+format, append([]interface{}{l.LogTraceId}, args...)...)
+}
+
+func (l *Logger) Debug(format string, args ...interface{}) {
+	sigolo.Debug("[%s] "+format, append([]interface{}{l.LogTraceId}, args...)...)
+}
+
+func (l *Logger) Err(format string, args ...interface{}) {
+	sigolo.Error("[%s] "+format, append([]interface{}{l.LogTraceId}, args...)...)
+}
+
+// Stack logs err together with its stack trace (as produced by github.com/pkg/errors), prefixed with the trace id.
+func (l *Logger) Stack(err error) {
+	sigolo.Error("[%s] %+v", l.LogTraceId, err)
+}
+
+func generateTraceId() string {
+	raw := make([]byte, 8)
+	if _, err := rand.Read(raw); err != nil {
+		// This should never happen; falling back to a fixed placeholder still keeps logging itself from failing.
+		return "unknown"
+	}
+	return hex.EncodeToString(raw)
+}
@@ -2,7 +2,6 @@ package util
 
 import (
 	"fmt"
-	"github.com/hauke96/sigolo"
 	"github.com/pkg/errors"
 	"net/http"
 	"strconv"
@@ -31,20 +30,22 @@ func GetIntParam(param string, r *http.Request) (int, error) {
 	return strconv.Atoi(valueString)
 }
 
-func ResponseBadRequest(w http.ResponseWriter, err error) {
-	ErrorResponse(w, err, http.StatusBadRequest)
+func ResponseBadRequest(w http.ResponseWriter, logger *Logger, err error) {
+	ErrorResponse(w, logger, err, http.StatusBadRequest)
 }
 
-func ResponseInternalError(w http.ResponseWriter, err error) {
-	ErrorResponse(w, err, http.StatusInternalServerError)
+func ResponseInternalError(w http.ResponseWriter, logger *Logger, err error) {
+	ErrorResponse(w, logger, err, http.StatusInternalServerError)
 }
 
-func ResponseUnauthorized(w http.ResponseWriter, err error) {
-	ErrorResponse(w, err, http.StatusUnauthorized)
+func ResponseUnauthorized(w http.ResponseWriter, logger *Logger, err error) {
+	ErrorResponse(w, logger, err, http.StatusUnauthorized)
 }
 
-func ErrorResponse(w http.ResponseWriter, err error, status int) {
-	sigolo.Error("ErrorResponse with status %d: %s", status, err.Error())
+// ErrorResponse writes err as the response body together with logger's trace id, so a client reporting a bug can
+// point at the exact request that failed.
+func ErrorResponse(w http.ResponseWriter, logger *Logger, err error, status int) {
+	logger.Err("ErrorResponse with status %d: %s", status, err.Error())
 	w.WriteHeader(status)
-	w.Write([]byte(err.Error()))
+	w.Write([]byte(fmt.Sprintf("%s (trace id: %s)", err.Error(), logger.LogTraceId)))
 }